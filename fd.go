@@ -0,0 +1,312 @@
+package netx
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// listenFdStart is the first file descriptor number that systemd-style
+// socket activation hands sockets off at (fd 0, 1, and 2 are stdin, stdout,
+// and stderr).
+const listenFdStart = 3
+
+// parseFD extracts the file descriptor number out of an address using the
+// fd:// scheme, returning ok == false if address doesn't use that scheme.
+func parseFD(address string) (n uintptr, ok bool, err error) {
+	const prefix = "fd://"
+
+	if !strings.HasPrefix(address, prefix) {
+		return 0, false, nil
+	}
+
+	i, err := strconv.Atoi(address[len(prefix):])
+	if err != nil {
+		return 0, true, fmt.Errorf("fd://%s: %s", address[len(prefix):], err)
+	}
+	if i < 0 {
+		return 0, true, fmt.Errorf("fd://%d: negative file descriptor", i)
+	}
+
+	return uintptr(i), true, nil
+}
+
+// resolveFD translates the descriptor number n found in a fd:// address into
+// the actual file descriptor to adopt, honoring the environment variables set
+// by systemd-style and socketmaster-style socket activation.
+//
+// When LISTEN_PID and LISTEN_FDS are set (systemd convention), n is treated
+// as an index into the block of descriptors starting at fd 3, and is only
+// honored if LISTEN_PID matches the current process. When SOCKETMASTER_FD is
+// set instead, n is added to it to support passing more than one descriptor.
+// Otherwise n is used as the literal file descriptor number.
+func resolveFD(n uintptr) (uintptr, error) {
+	if s := os.Getenv("LISTEN_PID"); len(s) != 0 {
+		pid, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("LISTEN_PID: %s", err)
+		}
+		if pid != os.Getpid() {
+			return 0, fmt.Errorf("LISTEN_PID %d does not match this process (%d)", pid, os.Getpid())
+		}
+
+		count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		if err != nil {
+			return 0, fmt.Errorf("LISTEN_FDS: %s", err)
+		}
+		if n >= uintptr(count) {
+			return 0, fmt.Errorf("fd://%d: out of range of the %d descriptors passed in LISTEN_FDS", n, count)
+		}
+
+		return listenFdStart + n, nil
+	}
+
+	if s := os.Getenv("SOCKETMASTER_FD"); len(s) != 0 {
+		fd, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("SOCKETMASTER_FD: %s", err)
+		}
+		return uintptr(fd) + n, nil
+	}
+
+	return n, nil
+}
+
+// systemdFDs returns the number of file descriptors passed to this process
+// via systemd-style socket activation, by reading the LISTEN_PID and
+// LISTEN_FDS environment variables. It returns 0, nil if LISTEN_PID isn't
+// set or doesn't match this process, which is not an error: it just means no
+// descriptors were passed this way.
+func systemdFDs() (int, error) {
+	s := os.Getenv("LISTEN_PID")
+	if len(s) == 0 {
+		return 0, nil
+	}
+
+	pid, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("LISTEN_PID: %s", err)
+	}
+	if pid != os.Getpid() {
+		return 0, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return 0, fmt.Errorf("LISTEN_FDS: %s", err)
+	}
+
+	return count, nil
+}
+
+// matchesAddr reports whether candidate, the local address of an inherited
+// socket, is one that Listen or ListenPacket would have bound for network and
+// one of addrs.
+func matchesAddr(candidate net.Addr, network string, addrs []string) bool {
+	switch a := candidate.(type) {
+	case *net.TCPAddr:
+		if network != "tcp" && network != "tcp4" && network != "tcp6" {
+			return false
+		}
+		for _, addr := range addrs {
+			if matchesHostPort(a.IP, a.Port, addr) {
+				return true
+			}
+		}
+
+	case *net.UDPAddr:
+		if network != "udp" && network != "udp4" && network != "udp6" {
+			return false
+		}
+		for _, addr := range addrs {
+			if matchesHostPort(a.IP, a.Port, addr) {
+				return true
+			}
+		}
+
+	case *net.UnixAddr:
+		if network != "unix" && network != "unixpacket" && network != "unixdgram" {
+			return false
+		}
+		for _, addr := range addrs {
+			if a.Name == addr {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchesHostPort reports whether ip and port, the local address of an
+// inherited socket, satisfy addr, a "host:port" string that was requested of
+// Listen or ListenPacket. A requested host of "" (any interface) matches any
+// ip, and either side being the unspecified address (e.g. "0.0.0.0" or "::")
+// is treated as matching the other, since that's how the OS itself resolves
+// a listen on the wildcard address.
+func matchesHostPort(ip net.IP, port int, addr string) bool {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	if p, err := strconv.Atoi(portStr); err != nil || p != port {
+		return false
+	}
+
+	if len(host) == 0 {
+		return true
+	}
+
+	reqIP := net.ParseIP(host)
+	if reqIP == nil {
+		return false
+	}
+
+	return ip.IsUnspecified() || reqIP.IsUnspecified() || ip.Equal(reqIP)
+}
+
+// systemdFilesMu guards systemdFiles.
+var systemdFilesMu sync.Mutex
+
+// systemdFiles caches the *os.File wrapping each fd passed to this process
+// via systemd-style socket activation, indexed by its offset from
+// listenFdStart. An *os.File owns its fd directly: closing one closes the
+// real descriptor, and so does letting one be garbage collected, since it
+// carries a finalizer that does the same. Probing a candidate's address to
+// see whether it matches what Listen or ListenPacket was asked for must
+// therefore never let an unclaimed candidate's *os.File fall out of scope,
+// or its descriptor could vanish (or get silently reused) before a later
+// call comes looking for it. Caching them here, for the life of the
+// process, is what keeps that from happening.
+var systemdFiles []*os.File
+
+// systemdFile returns the *os.File wrapping the i'th fd passed via
+// systemd-style socket activation, creating and caching it on first use.
+func systemdFile(i int) *os.File {
+	systemdFilesMu.Lock()
+	defer systemdFilesMu.Unlock()
+
+	for len(systemdFiles) <= i {
+		systemdFiles = append(systemdFiles, nil)
+	}
+	if systemdFiles[i] == nil {
+		systemdFiles[i] = os.NewFile(uintptr(listenFdStart+i), "listener")
+	}
+	return systemdFiles[i]
+}
+
+// systemdFileClaimed drops the i'th file from the cache once it's been
+// adopted by a Listener or PacketConn, since ownership of the underlying fd
+// has passed to whatever net.FileListener/net.FilePacketConn returned.
+func systemdFileClaimed(i int) {
+	systemdFilesMu.Lock()
+	defer systemdFilesMu.Unlock()
+
+	if i < len(systemdFiles) {
+		systemdFiles[i] = nil
+	}
+}
+
+// listenFromEnv looks for a socket, among those inherited via systemd-style
+// socket activation, whose local address matches network and one of addrs,
+// returning ok == false (with a nil error) if none was found, including when
+// no descriptors were passed at all. This lets Listen and ListenPacket honor
+// socket activation units that don't encode an explicit fd:// address.
+//
+// Candidates that don't match are left untouched (see systemdFiles) so that
+// probing one doesn't destroy a socket a later Listen or ListenPacket call
+// for a different address still needs.
+func listenFromEnv(network string, addrs []string) (lstn net.Listener, ok bool, err error) {
+	count, err := systemdFDs()
+	if err != nil || count == 0 {
+		return nil, false, err
+	}
+
+	for i := 0; i < count; i++ {
+		f := systemdFile(i)
+		if f == nil {
+			continue
+		}
+
+		candidate, cerr := net.FileListener(f)
+		if cerr != nil {
+			continue
+		}
+
+		if matchesAddr(candidate.Addr(), network, addrs) {
+			systemdFileClaimed(i)
+			f.Close()
+			return candidate, true, nil
+		}
+		candidate.Close()
+	}
+
+	return nil, false, nil
+}
+
+// listenPacketFromEnv is the net.PacketConn equivalent of listenFromEnv.
+func listenPacketFromEnv(network string, addrs []string) (conn net.PacketConn, ok bool, err error) {
+	count, err := systemdFDs()
+	if err != nil || count == 0 {
+		return nil, false, err
+	}
+
+	for i := 0; i < count; i++ {
+		f := systemdFile(i)
+		if f == nil {
+			continue
+		}
+
+		candidate, cerr := net.FilePacketConn(f)
+		if cerr != nil {
+			continue
+		}
+
+		if matchesAddr(candidate.LocalAddr(), network, addrs) {
+			systemdFileClaimed(i)
+			f.Close()
+			return candidate, true, nil
+		}
+		candidate.Close()
+	}
+
+	return nil, false, nil
+}
+
+// fdListener adopts the file descriptor fd as a net.Listener, validating
+// that it actually refers to a socket that can be listened on.
+func fdListener(fd uintptr) (net.Listener, error) {
+	f := os.NewFile(fd, "listener")
+	if f == nil {
+		return nil, fmt.Errorf("fd %d: not a valid file descriptor", fd)
+	}
+	defer f.Close()
+
+	lstn, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("fd %d: %s", fd, err)
+	}
+
+	return lstn, nil
+}
+
+// fdPacketConn adopts the file descriptor fd as a net.PacketConn, validating
+// that it actually refers to a socket that can be used for packet I/O.
+func fdPacketConn(fd uintptr) (net.PacketConn, error) {
+	f := os.NewFile(fd, "listener")
+	if f == nil {
+		return nil, fmt.Errorf("fd %d: not a valid file descriptor", fd)
+	}
+	defer f.Close()
+
+	conn, err := net.FilePacketConn(f)
+	if err != nil {
+		return nil, fmt.Errorf("fd %d: %s", fd, err)
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,252 @@
+package netx
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestParseFD(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		wantOK  bool
+		wantN   uintptr
+		wantErr bool
+	}{
+		{name: "not an fd address", address: "tcp://127.0.0.1:8080", wantOK: false},
+		{name: "valid index", address: "fd://3", wantOK: true, wantN: 3},
+		{name: "negative index", address: "fd://-1", wantOK: true, wantErr: true},
+		{name: "not a number", address: "fd://nope", wantOK: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, ok, err := parseFD(tt.address)
+
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got n=%d", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if ok && n != tt.wantN {
+				t.Errorf("n = %d, want %d", n, tt.wantN)
+			}
+		})
+	}
+}
+
+// withEnv sets the given environment variables for the duration of the
+// test, restoring whatever was there before (including unsetting variables
+// that weren't set) once it completes.
+func withEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+
+	for k, v := range env {
+		prev, had := os.LookupEnv(k)
+		os.Setenv(k, v)
+		t.Cleanup(func() {
+			if had {
+				os.Setenv(k, prev)
+			} else {
+				os.Unsetenv(k)
+			}
+		})
+	}
+}
+
+func TestResolveFD(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		n       uintptr
+		want    uintptr
+		wantErr bool
+	}{
+		{
+			name: "no socket activation env",
+			env:  map[string]string{"LISTEN_PID": "", "LISTEN_FDS": "", "SOCKETMASTER_FD": ""},
+			n:    2,
+			want: 2,
+		},
+		{
+			name: "socketmaster offset",
+			env:  map[string]string{"LISTEN_PID": "", "LISTEN_FDS": "", "SOCKETMASTER_FD": "5"},
+			n:    1,
+			want: 6,
+		},
+		{
+			name: "systemd activation for this pid",
+			env:  map[string]string{"LISTEN_PID": strconv.Itoa(os.Getpid()), "LISTEN_FDS": "2", "SOCKETMASTER_FD": ""},
+			n:    1,
+			want: listenFdStart + 1,
+		},
+		{
+			name:    "systemd activation index out of range",
+			env:     map[string]string{"LISTEN_PID": strconv.Itoa(os.Getpid()), "LISTEN_FDS": "2", "SOCKETMASTER_FD": ""},
+			n:       2,
+			wantErr: true,
+		},
+		{
+			name:    "systemd activation for a different pid",
+			env:     map[string]string{"LISTEN_PID": strconv.Itoa(os.Getpid() + 1), "LISTEN_FDS": "2", "SOCKETMASTER_FD": ""},
+			n:       0,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withEnv(t, tt.env)
+
+			got, err := resolveFD(tt.n)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveFD(%d) = %d, want %d", tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSystemdFDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "not set",
+			env:  map[string]string{"LISTEN_PID": "", "LISTEN_FDS": ""},
+			want: 0,
+		},
+		{
+			name: "different pid",
+			env:  map[string]string{"LISTEN_PID": strconv.Itoa(os.Getpid() + 1), "LISTEN_FDS": "3"},
+			want: 0,
+		},
+		{
+			name: "matches this pid",
+			env:  map[string]string{"LISTEN_PID": strconv.Itoa(os.Getpid()), "LISTEN_FDS": "3"},
+			want: 3,
+		},
+		{
+			name:    "unparseable count",
+			env:     map[string]string{"LISTEN_PID": strconv.Itoa(os.Getpid()), "LISTEN_FDS": "nope"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withEnv(t, tt.env)
+
+			got, err := systemdFDs()
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("systemdFDs() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesAddr(t *testing.T) {
+	tests := []struct {
+		name      string
+		candidate net.Addr
+		network   string
+		addrs     []string
+		want      bool
+	}{
+		{
+			name:      "tcp exact match",
+			candidate: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 8080},
+			network:   "tcp",
+			addrs:     []string{"192.0.2.1:8080"},
+			want:      true,
+		},
+		{
+			name:      "tcp wildcard candidate matches any host",
+			candidate: &net.TCPAddr{IP: net.IPv4zero, Port: 8080},
+			network:   "tcp",
+			addrs:     []string{"192.0.2.1:8080"},
+			want:      true,
+		},
+		{
+			name:      "tcp wildcard request matches any host",
+			candidate: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 8080},
+			network:   "tcp",
+			addrs:     []string{":8080"},
+			want:      true,
+		},
+		{
+			name:      "tcp port mismatch",
+			candidate: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 8080},
+			network:   "tcp",
+			addrs:     []string{"192.0.2.1:9090"},
+			want:      false,
+		},
+		{
+			name:      "tcp host mismatch",
+			candidate: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 8080},
+			network:   "tcp",
+			addrs:     []string{"192.0.2.2:8080"},
+			want:      false,
+		},
+		{
+			name:      "network family mismatch",
+			candidate: &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 8080},
+			network:   "tcp",
+			addrs:     []string{"192.0.2.1:8080"},
+			want:      false,
+		},
+		{
+			name:      "unix socket path match",
+			candidate: &net.UnixAddr{Name: "/run/app.sock"},
+			network:   "unix",
+			addrs:     []string{"/run/app.sock"},
+			want:      true,
+		},
+		{
+			name:      "unix socket path mismatch",
+			candidate: &net.UnixAddr{Name: "/run/app.sock"},
+			network:   "unix",
+			addrs:     []string{"/run/other.sock"},
+			want:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesAddr(tt.candidate, tt.network, tt.addrs); got != tt.want {
+				t.Errorf("matchesAddr() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package brotli
+
+import (
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// ContentDecoder implements the httpx.ContentDecoder interface for the
+// brotli algorithm.
+type ContentDecoder struct{}
+
+// NewContentDecoder creates a new content decoder.
+func NewContentDecoder() *ContentDecoder {
+	return &ContentDecoder{}
+}
+
+// Coding satsifies httpx.ContentDecoder.
+func (d *ContentDecoder) Coding() string {
+	return "br"
+}
+
+// NewReader satsifies httpx.ContentDecoder.
+func (d *ContentDecoder) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(brotli.NewReader(r)), nil
+}
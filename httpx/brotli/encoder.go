@@ -0,0 +1,37 @@
+package brotli
+
+import (
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// ContentEncoder implements the httpx.ContentEncoder interface for the
+// brotli algorithm.
+type ContentEncoder struct {
+	Level int
+}
+
+// NewContentEncoder creates a new content encoder with the default
+// compression level.
+func NewContentEncoder() *ContentEncoder {
+	return NewContentEncoderLevel(brotli.DefaultCompression)
+}
+
+// NewContentEncoderLevel creates a new content encoder with the given
+// compression level.
+func NewContentEncoderLevel(level int) *ContentEncoder {
+	return &ContentEncoder{
+		Level: level,
+	}
+}
+
+// Coding satsifies httpx.ContentEncoder.
+func (e *ContentEncoder) Coding() string {
+	return "br"
+}
+
+// NewWriter satsifies httpx.ContentEncoder.
+func (e *ContentEncoder) NewWriter(w io.Writer) io.WriteCloser {
+	return brotli.NewWriterLevel(w, e.Level)
+}
@@ -0,0 +1,91 @@
+// Package httpx provides HTTP helpers that build on top of netx.
+package httpx
+
+import (
+	"io"
+	"sync"
+)
+
+// ContentEncoder knows how to compress an HTTP response body using a given
+// content coding, the value negotiated through the Accept-Encoding and
+// Content-Encoding headers (e.g. "gzip", "br", "zstd").
+//
+// Implementations live in sibling packages, see httpx/zlib, httpx/brotli,
+// and httpx/zstd.
+type ContentEncoder interface {
+	// Coding returns the content coding this encoder implements.
+	Coding() string
+
+	// NewWriter returns a writer that compresses everything written to it
+	// into w using this encoder's coding.
+	NewWriter(w io.Writer) io.WriteCloser
+}
+
+// ContentDecoder is the mirror image of ContentEncoder, decompressing a body
+// that was encoded with the corresponding coding.
+type ContentDecoder interface {
+	// Coding returns the content coding this decoder implements.
+	Coding() string
+
+	// NewReader returns a reader that decompresses r, which was encoded
+	// using this decoder's coding.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// Encodings is a registry of ContentEncoder/ContentDecoder pairs keyed by
+// content coding, used to negotiate compression over Accept-Encoding. The
+// zero value is an empty registry ready to use.
+type Encodings struct {
+	mu       sync.RWMutex
+	encoders map[string]ContentEncoder
+	decoders map[string]ContentDecoder
+	order    []string // codings in registration order, so negotiation picks a stable preference
+}
+
+// DefaultEncodings is the registry used by Register and Middleware when no
+// explicit *Encodings is given.
+var DefaultEncodings = &Encodings{}
+
+// Register adds enc and dec to the DefaultEncodings registry.
+func Register(enc ContentEncoder, dec ContentDecoder) {
+	DefaultEncodings.Register(enc, dec)
+}
+
+// Register adds enc and dec to the registry, keyed by their Coding. It
+// panics if enc and dec don't agree on the coding they implement.
+func (e *Encodings) Register(enc ContentEncoder, dec ContentDecoder) {
+	if enc.Coding() != dec.Coding() {
+		panic("httpx: encoder and decoder codings don't match: " + enc.Coding() + " != " + dec.Coding())
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.encoders == nil {
+		e.encoders = make(map[string]ContentEncoder)
+		e.decoders = make(map[string]ContentDecoder)
+	}
+
+	if _, ok := e.encoders[enc.Coding()]; !ok {
+		e.order = append(e.order, enc.Coding())
+	}
+
+	e.encoders[enc.Coding()] = enc
+	e.decoders[dec.Coding()] = dec
+}
+
+// Encoder returns the ContentEncoder registered for coding, or nil if none
+// was registered.
+func (e *Encodings) Encoder(coding string) ContentEncoder {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.encoders[coding]
+}
+
+// Decoder returns the ContentDecoder registered for coding, or nil if none
+// was registered.
+func (e *Encodings) Decoder(coding string) ContentDecoder {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.decoders[coding]
+}
@@ -0,0 +1,147 @@
+package httpx
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Middleware wraps next with DefaultEncodings.Middleware.
+func Middleware(next http.Handler) http.Handler {
+	return DefaultEncodings.Middleware(next)
+}
+
+// Middleware returns a handler that negotiates a content coding registered
+// in e against the request's Accept-Encoding header, then transparently
+// compresses whatever next writes through the chosen ContentEncoder, setting
+// Content-Encoding and adding Accept-Encoding to Vary. Requests that don't
+// accept any registered coding are passed through unchanged.
+func (e *Encodings) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		coding := e.negotiate(r.Header.Get("Accept-Encoding"))
+		if len(coding) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		enc := e.Encoder(coding)
+
+		h := w.Header()
+		h.Add("Vary", "Accept-Encoding")
+		h.Set("Content-Encoding", coding)
+
+		cw := enc.NewWriter(w)
+		defer cw.Close()
+
+		next.ServeHTTP(&encodingResponseWriter{ResponseWriter: w, w: cw}, r)
+	})
+}
+
+// negotiate picks the best coding registered in e that's acceptable
+// according to the Accept-Encoding header value accept, returning "" if none
+// match (including when the client only accepts "identity"). Ties (e.g. a
+// bare "*", or several codings at the same q-value) are broken by picking
+// whichever matching coding was registered with e first, so the outcome
+// doesn't depend on map iteration order and is stable across requests.
+func (e *Encodings) negotiate(accept string) string {
+	if len(accept) == 0 {
+		return ""
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if len(e.order) == 0 {
+		return ""
+	}
+
+	explicit := make(map[string]float64)
+	wildcardQ, hasWildcard := 0.0, false
+
+	for _, part := range strings.Split(accept, ",") {
+		coding, q := parseQValue(part)
+		if len(coding) == 0 {
+			continue
+		}
+
+		if coding == "*" {
+			wildcardQ, hasWildcard = q, true
+			continue
+		}
+
+		explicit[coding] = q
+	}
+
+	best, bestQ := "", 0.0
+
+	for _, coding := range e.order {
+		if _, ok := e.encoders[coding]; !ok {
+			continue
+		}
+
+		// An explicit entry for this coding always wins over "*", even if
+		// its q-value is lower, per the Accept-Encoding spec.
+		q, ok := explicit[coding]
+		if !ok {
+			if !hasWildcard {
+				continue
+			}
+			q = wildcardQ
+		}
+
+		if q > 0 && q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+
+	return best
+}
+
+// parseQValue splits an Accept-Encoding list element like "gzip;q=0.8" into
+// its coding and q-value, defaulting the q-value to 1 when absent or
+// unparseable. A q-value of 0 means the coding is explicitly rejected; the
+// coding name is still returned so the caller can tell a rejection apart
+// from a coding that simply wasn't mentioned.
+func parseQValue(part string) (coding string, q float64) {
+	q = 1
+
+	fields := strings.Split(part, ";")
+	coding = strings.TrimSpace(fields[0])
+
+	for _, f := range fields[1:] {
+		f = strings.TrimSpace(f)
+		if v := strings.TrimPrefix(f, "q="); v != f {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+	}
+
+	return
+}
+
+// encodingResponseWriter wraps an http.ResponseWriter, sending writes
+// through w (a ContentEncoder's io.WriteCloser) instead of straight to the
+// underlying connection. It strips any Content-Length set on the response
+// right before headers are sent, since next may set one reflecting the
+// uncompressed body size (e.g. via http.ServeContent), which would no longer
+// match the compressed bytes actually written.
+type encodingResponseWriter struct {
+	http.ResponseWriter
+	w           io.WriteCloser
+	wroteHeader bool
+}
+
+func (e *encodingResponseWriter) WriteHeader(code int) {
+	e.wroteHeader = true
+	e.Header().Del("Content-Length")
+	e.ResponseWriter.WriteHeader(code)
+}
+
+func (e *encodingResponseWriter) Write(b []byte) (int, error) {
+	if !e.wroteHeader {
+		e.WriteHeader(http.StatusOK)
+	}
+	return e.w.Write(b)
+}
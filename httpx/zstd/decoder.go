@@ -0,0 +1,41 @@
+package zstd
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ContentDecoder implements the httpx.ContentDecoder interface for the
+// zstandard algorithm.
+type ContentDecoder struct{}
+
+// NewContentDecoder creates a new content decoder.
+func NewContentDecoder() *ContentDecoder {
+	return &ContentDecoder{}
+}
+
+// Coding satsifies httpx.ContentDecoder.
+func (d *ContentDecoder) Coding() string {
+	return "zstd"
+}
+
+// NewReader satsifies httpx.ContentDecoder.
+func (d *ContentDecoder) NewReader(r io.Reader) (io.ReadCloser, error) {
+	dec, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return zstdReadCloser{dec}, nil
+}
+
+// zstdReadCloser adapts a *zstd.Decoder, whose Close method doesn't return
+// an error, to io.ReadCloser.
+type zstdReadCloser struct {
+	*zstd.Decoder
+}
+
+func (r zstdReadCloser) Close() error {
+	r.Decoder.Close()
+	return nil
+}
@@ -0,0 +1,41 @@
+package zstd
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ContentEncoder implements the httpx.ContentEncoder interface for the
+// zstandard algorithm.
+type ContentEncoder struct {
+	Level zstd.EncoderLevel
+}
+
+// NewContentEncoder creates a new content encoder with the default
+// compression level.
+func NewContentEncoder() *ContentEncoder {
+	return NewContentEncoderLevel(zstd.SpeedDefault)
+}
+
+// NewContentEncoderLevel creates a new content encoder with the given
+// compression level.
+func NewContentEncoderLevel(level zstd.EncoderLevel) *ContentEncoder {
+	return &ContentEncoder{
+		Level: level,
+	}
+}
+
+// Coding satsifies httpx.ContentEncoder.
+func (e *ContentEncoder) Coding() string {
+	return "zstd"
+}
+
+// NewWriter satsifies httpx.ContentEncoder.
+func (e *ContentEncoder) NewWriter(w io.Writer) io.WriteCloser {
+	z, err := zstd.NewWriter(w, zstd.WithEncoderLevel(e.Level))
+	if err != nil {
+		panic(err)
+	}
+	return z
+}
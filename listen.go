@@ -1,11 +1,32 @@
 package netx
 
 import (
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"net"
 	"strings"
 )
 
+// secureProtocols lists the schemes that require a tls.Config to establish,
+// and therefore can't be dialed through Listen, only through ListenTLS.
+var secureProtocols = []string{
+	"tls",
+	"https",
+	"quic",
+	"udp+quic",
+}
+
+// needsTLS reports whether address is prefixed by one of secureProtocols.
+func needsTLS(address string) bool {
+	for _, proto := range secureProtocols {
+		if strings.HasPrefix(address, proto+"://") {
+			return true
+		}
+	}
+	return false
+}
+
 // Listen is equivalent to net.Listen but guesses the network from the address.
 //
 // The function accepts addresses that may be prefixed by a URL scheme to set
@@ -17,20 +38,52 @@ import (
 //
 // If the port is omitted for network addresses the operating system will pick
 // one automatically.
+//
+// The address may also use the fd:// scheme (e.g. "fd://0") to adopt a
+// socket that was already opened by a parent process and inherited through
+// socket activation, rather than binding a new one, see resolveFD.
+//
+// If address doesn't use the fd:// scheme but this process was started with
+// systemd-style socket activation (LISTEN_PID and LISTEN_FDS set), Listen
+// first looks for an inherited descriptor whose address matches address,
+// adopting it instead of binding a new socket if one is found.
+//
+// The tls://, https://, quic://, and udp+quic:// schemes are recognized but
+// rejected, since encrypting the connection requires a *tls.Config; use
+// ListenTLS for those.
 func Listen(address string) (lstn net.Listener, err error) {
+	if n, ok, ferr := parseFD(address); ok {
+		if ferr != nil {
+			return nil, ferr
+		}
+		fd, ferr := resolveFD(n)
+		if ferr != nil {
+			return nil, ferr
+		}
+		return fdListener(fd)
+	}
+
 	var network string
 	var addrs []string
 
-	if network, addrs, err = resolveListen(address, "tcp", "unix", []string{
+	if network, addrs, err = resolveListen(address, "tcp", "unix", append([]string{
 		"tcp4",
 		"tcp6",
 		"tcp",
 		"unixpacket",
 		"unix",
-	}); err != nil {
+	}, secureProtocols...)); err != nil {
 		return
 	}
 
+	if needsTLS(network + "://") {
+		return nil, fmt.Errorf("netx: %s requires a tls.Config, use ListenTLS instead of Listen", network)
+	}
+
+	if lstn, ok, ferr := listenFromEnv(network, addrs); ok || ferr != nil {
+		return lstn, ferr
+	}
+
 	// TOOD: listen on all addresses?
 	for _, address := range addrs {
 		if lstn, err = net.Listen(network, address); err == nil {
@@ -41,9 +94,68 @@ func Listen(address string) (lstn net.Listener, err error) {
 	return
 }
 
+// ListenTLS is similar to Listen but recognizes the tls://, https://, quic://,
+// and udp+quic:// schemes (defaulting to tls:// when none is given), as well
+// as tcp://, tcp4://, and tcp6://, encrypting the connection using cfg. It
+// does not accept the fd://, unix://, or unixpacket:// schemes, and does not
+// look for an inherited socket activation descriptor.
+//
+// For tls:// and https://, the resolved address is listened on as a regular
+// TCP socket and then wrapped with tls.NewListener. For quic:// and
+// udp+quic://, a QUIC listener is opened instead, surfacing each accepted
+// stream as a net.Conn so it flows through Handler.ServeConn like any other
+// transport.
+func ListenTLS(address string, cfg *tls.Config) (lstn net.Listener, err error) {
+	var network string
+	var addrs []string
+
+	if network, addrs, err = resolveListen(address, "tls", "tls", append([]string{
+		"tcp4",
+		"tcp6",
+		"tcp",
+	}, secureProtocols...)); err != nil {
+		return
+	}
+
+	switch network {
+	case "quic", "udp+quic":
+		return listenQUIC(addrs, cfg)
+	case "tls", "https":
+		network = "tcp"
+	}
+
+	// TODO: listen on all addresses?
+	for _, address := range addrs {
+		if lstn, err = net.Listen(network, address); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	return tls.NewListener(lstn, cfg), nil
+}
+
 // ListenPacket is similar to Listen but returns a PacketConn, nad works with
 // udp, ip, or unixdgram protocols.
+//
+// Like Listen, the address may use the fd:// scheme to adopt an inherited
+// socket instead of opening a new one, and likewise falls back to matching
+// an inherited systemd-style socket activation descriptor against address
+// when the fd:// scheme isn't used.
 func ListenPacket(address string) (conn net.PacketConn, err error) {
+	if n, ok, ferr := parseFD(address); ok {
+		if ferr != nil {
+			return nil, ferr
+		}
+		fd, ferr := resolveFD(n)
+		if ferr != nil {
+			return nil, ferr
+		}
+		return fdPacketConn(fd)
+	}
+
 	var network string
 	var addrs []string
 
@@ -59,6 +171,10 @@ func ListenPacket(address string) (conn net.PacketConn, err error) {
 		return
 	}
 
+	if conn, ok, ferr := listenPacketFromEnv(network, addrs); ok || ferr != nil {
+		return conn, ferr
+	}
+
 	// TODO: listen on all addresses?
 	for _, address := range addrs {
 		if conn, err = net.ListenPacket(network, address); err == nil {
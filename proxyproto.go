@@ -0,0 +1,251 @@
+package netx
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyProtoV2Sig is the 12-byte signature that introduces a PROXY protocol
+// v2 header, see http://www.haproxy.org/download/2.0/doc/proxy-protocol.txt.
+var proxyProtoV2Sig = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+const (
+	// proxyProtoV1MaxHeader is the longest a v1 text header may be per spec.
+	proxyProtoV1MaxHeader = 107
+
+	// proxyProtoV2MaxLength caps the v2 address block length we accept,
+	// guarding against a malicious peer claiming an unreasonable size.
+	proxyProtoV2MaxLength = 4096
+
+	// defaultProxyProtoHeaderTimeout bounds how long a connection's first
+	// Read, RemoteAddr, or LocalAddr waits for a PROXY protocol header to
+	// arrive before giving up on it.
+	defaultProxyProtoHeaderTimeout = 3 * time.Second
+)
+
+// ProxyProtocolListener wraps a net.Listener, parsing a HAProxy PROXY
+// protocol header (v1 or v2) off of every accepted connection and exposing
+// the original client address through RemoteAddr/LocalAddr. This lets a
+// Server sit correctly behind an L4 load balancer like HAProxy or an AWS
+// NLB while the Handler interface stays unchanged.
+type ProxyProtocolListener struct {
+	net.Listener
+
+	// HeaderTimeout bounds how long an accepted connection waits to read its
+	// PROXY protocol header, on its first Read, RemoteAddr, or LocalAddr call.
+	// Defaults to 3 seconds.
+	HeaderTimeout time.Duration
+}
+
+// NewProxyProtocolListener wraps lstn to parse PROXY protocol headers off of
+// every accepted connection, using the default header timeout.
+func NewProxyProtocolListener(lstn net.Listener) *ProxyProtocolListener {
+	return &ProxyProtocolListener{Listener: lstn}
+}
+
+// Accept satisfies net.Listener. It returns as soon as the underlying
+// Listener does, without reading anything off the new connection: the PROXY
+// protocol header is instead parsed lazily, on the connection's own goroutine,
+// the first time it's Read from or its RemoteAddr/LocalAddr are consulted.
+// This keeps a client that completes the handshake and then withholds the
+// header from stalling Accept, and therefore from stalling every other
+// connection sharing the same accept loop (see Server.Serve).
+func (l *ProxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := l.HeaderTimeout
+	if timeout <= 0 {
+		timeout = defaultProxyProtoHeaderTimeout
+	}
+
+	return &proxyProtoConn{Conn: conn, timeout: timeout}, nil
+}
+
+// proxyProtoConn wraps a net.Conn, parsing the PROXY protocol header off of
+// it on first use rather than at Accept time, and then serving reads out of
+// the buffered reader left behind by that parse so no payload bytes read
+// ahead in the process are lost.
+type proxyProtoConn struct {
+	net.Conn
+	timeout time.Duration
+
+	once       sync.Once
+	err        error
+	r          *bufio.Reader
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+// header parses the PROXY protocol header the first time it's called,
+// caching the result (including any error) for subsequent calls.
+func (c *proxyProtoConn) header() error {
+	c.once.Do(func() {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+			c.err = err
+			return
+		}
+		defer c.Conn.SetReadDeadline(time.Time{})
+
+		r := bufio.NewReaderSize(c.Conn, proxyProtoV2MaxLength+16)
+
+		var src, dst net.Addr
+		var err error
+
+		if sig, peekErr := r.Peek(len(proxyProtoV2Sig)); peekErr == nil && bytes.Equal(sig, proxyProtoV2Sig) {
+			src, dst, err = parseProxyProtoV2(r)
+		} else {
+			src, dst, err = parseProxyProtoV1(r)
+		}
+		if err != nil {
+			c.err = err
+			return
+		}
+
+		c.r, c.remoteAddr, c.localAddr = r, src, dst
+	})
+
+	return c.err
+}
+
+// Read satisfies net.Conn, parsing the PROXY protocol header on the first
+// call and reading through the buffered reader left behind by that parse on
+// every call.
+func (c *proxyProtoConn) Read(b []byte) (int, error) {
+	if err := c.header(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr satisfies net.Conn, reporting the client address carried in the
+// PROXY protocol header, parsing it first if that hasn't happened yet. It
+// falls back to the underlying conn's own RemoteAddr if the header can't be
+// parsed.
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	if err := c.header(); err != nil {
+		return c.Conn.RemoteAddr()
+	}
+	return c.remoteAddr
+}
+
+// LocalAddr satisfies net.Conn, reporting the destination address carried in
+// the PROXY protocol header, parsing it first if that hasn't happened yet. It
+// falls back to the underlying conn's own LocalAddr if the header can't be
+// parsed.
+func (c *proxyProtoConn) LocalAddr() net.Addr {
+	if err := c.header(); err != nil {
+		return c.Conn.LocalAddr()
+	}
+	return c.localAddr
+}
+
+// parseProxyProtoV1 parses the text form of the header, e.g.
+// "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n".
+func parseProxyProtoV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	line := make([]byte, 0, proxyProtoV1MaxHeader)
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, fmt.Errorf("netx: proxy protocol: %s", err)
+		}
+
+		line = append(line, b)
+
+		if n := len(line); n >= 2 && line[n-2] == '\r' && line[n-1] == '\n' {
+			break
+		}
+		if len(line) > proxyProtoV1MaxHeader {
+			return nil, nil, errors.New("netx: proxy protocol: v1 header too long")
+		}
+	}
+
+	fields := strings.Fields(strings.TrimSuffix(string(line), "\r\n"))
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, nil, errors.New("netx: proxy protocol: malformed v1 header")
+	}
+
+	if fields[1] == "UNKNOWN" {
+		return &net.TCPAddr{}, &net.TCPAddr{}, nil
+	}
+
+	if len(fields) != 6 {
+		return nil, nil, errors.New("netx: proxy protocol: malformed v1 header")
+	}
+
+	srcIP := net.ParseIP(fields[2])
+	dstIP := net.ParseIP(fields[3])
+	srcPort, srcErr := strconv.Atoi(fields[4])
+	dstPort, dstErr := strconv.Atoi(fields[5])
+
+	if srcIP == nil || dstIP == nil || srcErr != nil || dstErr != nil {
+		return nil, nil, errors.New("netx: proxy protocol: malformed v1 address block")
+	}
+
+	return &net.TCPAddr{IP: srcIP, Port: srcPort}, &net.TCPAddr{IP: dstIP, Port: dstPort}, nil
+}
+
+// parseProxyProtoV2 parses the binary form of the header: the 12-byte
+// signature (already peeked by the caller), a version/command byte, a
+// family/protocol byte, a 2-byte big-endian length, and the address block.
+func parseProxyProtoV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	hdr := make([]byte, len(proxyProtoV2Sig)+4)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, nil, fmt.Errorf("netx: proxy protocol: %s", err)
+	}
+
+	verCmd := hdr[12]
+	famProto := hdr[13]
+	length := int(hdr[14])<<8 | int(hdr[15])
+
+	if verCmd>>4 != 2 {
+		return nil, nil, fmt.Errorf("netx: proxy protocol: unsupported v2 version %d", verCmd>>4)
+	}
+	if length > proxyProtoV2MaxLength {
+		return nil, nil, errors.New("netx: proxy protocol: v2 header too long")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, nil, fmt.Errorf("netx: proxy protocol: %s", err)
+	}
+
+	if cmd := verCmd & 0x0F; cmd == 0x00 {
+		// LOCAL: a health check from the proxy itself, the address block
+		// carries no meaningful addresses.
+		return &net.TCPAddr{}, &net.TCPAddr{}, nil
+	}
+
+	switch famProto {
+	case 0x11, 0x12: // AF_INET, TCP or UDP
+		if len(body) < 12 {
+			return nil, nil, errors.New("netx: proxy protocol: short v2 ipv4 address block")
+		}
+		src := &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(body[8])<<8 | int(body[9])}
+		dst := &net.TCPAddr{IP: net.IP(body[4:8]), Port: int(body[10])<<8 | int(body[11])}
+		return src, dst, nil
+
+	case 0x21, 0x22: // AF_INET6, TCP or UDP
+		if len(body) < 36 {
+			return nil, nil, errors.New("netx: proxy protocol: short v2 ipv6 address block")
+		}
+		src := &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(body[32])<<8 | int(body[33])}
+		dst := &net.TCPAddr{IP: net.IP(body[16:32]), Port: int(body[34])<<8 | int(body[35])}
+		return src, dst, nil
+
+	default:
+		// AF_UNIX or unspecified: no net.Addr can represent it meaningfully.
+		return &net.TCPAddr{}, &net.TCPAddr{}, nil
+	}
+}
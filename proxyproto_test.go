@@ -0,0 +1,159 @@
+package netx
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseProxyProtoV1(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		wantSrc string
+		wantDst string
+		wantErr bool
+	}{
+		{
+			name:    "tcp4",
+			header:  "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n",
+			wantSrc: "192.0.2.1:56324",
+			wantDst: "192.0.2.2:443",
+		},
+		{
+			name:    "tcp6",
+			header:  "PROXY TCP6 ::1 ::2 56324 443\r\n",
+			wantSrc: "[::1]:56324",
+			wantDst: "[::2]:443",
+		},
+		{
+			name:    "unknown",
+			header:  "PROXY UNKNOWN\r\n",
+			wantSrc: ":0",
+			wantDst: ":0",
+		},
+		{
+			name:    "missing trailing crlf",
+			header:  "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443",
+			wantErr: true,
+		},
+		{
+			name:    "too few fields",
+			header:  "PROXY TCP4 192.0.2.1\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "bad keyword",
+			header:  "GARBAGE TCP4 192.0.2.1 192.0.2.2 56324 443\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "unparseable address",
+			header:  "PROXY TCP4 not-an-ip 192.0.2.2 56324 443\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "header too long",
+			header:  "PROXY TCP4 " + strings.Repeat("1", proxyProtoV1MaxHeader) + " 192.0.2.2 56324 443\r\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dst, err := parseProxyProtoV1(bufio.NewReader(strings.NewReader(tt.header)))
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got src=%v dst=%v", src, dst)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if src.String() != tt.wantSrc {
+				t.Errorf("src = %s, want %s", src, tt.wantSrc)
+			}
+			if dst.String() != tt.wantDst {
+				t.Errorf("dst = %s, want %s", dst, tt.wantDst)
+			}
+		})
+	}
+}
+
+func TestParseProxyProtoV2(t *testing.T) {
+	v4Header := func(famProto byte, body []byte) []byte {
+		hdr := append([]byte{}, proxyProtoV2Sig...)
+		hdr = append(hdr, 0x21, famProto, byte(len(body)>>8), byte(len(body)))
+		return append(hdr, body...)
+	}
+
+	ipv4Body := append(append(net.IPv4(192, 0, 2, 1).To4(), net.IPv4(192, 0, 2, 2).To4()...), 0xdc, 0x04, 0x01, 0xbb)
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantSrc string
+		wantDst string
+		wantErr bool
+	}{
+		{
+			name:    "tcp over ipv4",
+			input:   v4Header(0x11, ipv4Body),
+			wantSrc: "192.0.2.1:56324",
+			wantDst: "192.0.2.2:443",
+		},
+		{
+			name:    "local command carries no address",
+			input:   append(append([]byte{}, proxyProtoV2Sig...), 0x20, 0x00, 0x00, 0x00),
+			wantSrc: ":0",
+			wantDst: ":0",
+		},
+		{
+			name:    "unsupported version",
+			input:   v4Header(0x11, ipv4Body)[:12+4], // will be mutated below
+			wantErr: true,
+		},
+		{
+			name:    "truncated body",
+			input:   append(append(append([]byte{}, proxyProtoV2Sig...), 0x21, 0x11, 0x00, 0x0c), ipv4Body[:4]...),
+			wantErr: true,
+		},
+		{
+			name:    "oversized length",
+			input:   append(append([]byte{}, proxyProtoV2Sig...), 0x21, 0x11, 0xff, 0xff),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := tt.input
+			if tt.name == "unsupported version" {
+				input = append([]byte{}, input...)
+				input[12] = 0x10 // version 1, which this parser doesn't support
+			}
+
+			src, dst, err := parseProxyProtoV2(bufio.NewReader(bytes.NewReader(input)))
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got src=%v dst=%v", src, dst)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if src.String() != tt.wantSrc {
+				t.Errorf("src = %s, want %s", src, tt.wantSrc)
+			}
+			if dst.String() != tt.wantDst {
+				t.Errorf("dst = %s, want %s", dst, tt.wantDst)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package netx
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// defaultQUICFirstStreamTimeout bounds how long a freshly accepted QUIC
+// connection is given to open its first stream before it's abandoned and
+// closed. Without this, a peer that completes the QUIC handshake and never
+// opens a stream would hold the connection (and its accept goroutine) open
+// for the life of the process.
+const defaultQUICFirstStreamTimeout = 10 * time.Second
+
+// listenQUIC opens a QUIC listener on the first address in addrs that can be
+// bound, wrapping it so it satisfies net.Listener.
+func listenQUIC(addrs []string, cfg *tls.Config) (net.Listener, error) {
+	var lstn *quic.Listener
+	var err error
+
+	for _, addr := range addrs {
+		if lstn, err = quic.ListenAddr(addr, cfg, nil); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	l := &quicListener{
+		lstn:    lstn,
+		streams: make(chan net.Conn),
+		closed:  make(chan struct{}),
+	}
+	go l.acceptConns()
+
+	return l, nil
+}
+
+// quicListener adapts a *quic.Listener to the net.Listener interface. Rather
+// than surfacing only the first stream of each accepted connection, every
+// accepted connection is handed its own goroutine that accepts every stream
+// opened on it for as long as the connection lives, feeding each one to
+// Accept as its own net.Conn over streams. This means Accept itself never
+// blocks on a single connection, slow or otherwise: it only ever waits on
+// whichever stream, from any connection, becomes available first.
+type quicListener struct {
+	lstn    *quic.Listener
+	streams chan net.Conn
+	closed  chan struct{}
+}
+
+// acceptConns accepts QUIC connections for the lifetime of the listener,
+// handing each one to its own stream-accepting goroutine.
+func (l *quicListener) acceptConns() {
+	for {
+		conn, err := l.lstn.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		go l.acceptStreams(conn)
+	}
+}
+
+// acceptStreams accepts every stream opened on conn, surfacing each as its
+// own net.Conn via l.streams, until conn is closed, errors, or fails to open
+// its first stream within defaultQUICFirstStreamTimeout. It closes conn
+// before returning, whatever the reason.
+func (l *quicListener) acceptStreams(conn quic.Connection) {
+	first := true
+
+	for {
+		ctx := context.Background()
+		if first {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, defaultQUICFirstStreamTimeout)
+			defer cancel()
+		}
+
+		stream, err := conn.AcceptStream(ctx)
+		if err != nil {
+			conn.CloseWithError(0, "")
+			return
+		}
+		first = false
+
+		select {
+		case l.streams <- &quicConn{Stream: stream, conn: conn}:
+		case <-l.closed:
+			stream.CancelRead(0)
+			conn.CloseWithError(0, "")
+			return
+		}
+	}
+}
+
+// Accept satisfies net.Listener, returning the next stream surfaced by any
+// accepted QUIC connection.
+func (l *quicListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.streams:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close satisfies net.Listener.
+func (l *quicListener) Close() error {
+	select {
+	case <-l.closed:
+	default:
+		close(l.closed)
+	}
+	return l.lstn.Close()
+}
+
+// Addr satisfies net.Listener.
+func (l *quicListener) Addr() net.Addr { return l.lstn.Addr() }
+
+// quicConn adapts a quic.Stream, together with the quic.Connection it
+// belongs to, to the net.Conn interface so it can be handled through the
+// same Handler.ServeConn contract as any other transport.
+type quicConn struct {
+	quic.Stream
+	conn quic.Connection
+}
+
+// LocalAddr satisfies net.Conn.
+func (c *quicConn) LocalAddr() net.Addr { return c.conn.LocalAddr() }
+
+// RemoteAddr satisfies net.Conn.
+func (c *quicConn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
@@ -2,10 +2,18 @@ package netx
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
 	"log"
 	"net"
+	"os"
+	"os/exec"
+	"os/signal"
 	"runtime"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -48,20 +56,79 @@ func (f HandlerFunc) ServeConn(conn net.Conn) {
 	f(conn)
 }
 
+// ConnState represents the state of a connection tracked by a Server, passed
+// to the optional Server.ConnState hook. It mirrors net/http.ConnState.
+type ConnState int
+
+const (
+	// StateNew represents a new connection that is expected to call into the
+	// Handler soon.
+	StateNew ConnState = iota
+
+	// StateActive represents a connection that has had ServeConn invoked on
+	// it and is not currently idle.
+	StateActive
+
+	// StateClosed represents a closed connection, whether it was closed
+	// normally, by the Handler, or force-closed by Server.Shutdown. This is
+	// a terminal state.
+	StateClosed
+)
+
+func (c ConnState) String() string {
+	switch c {
+	case StateNew:
+		return "new"
+	case StateActive:
+		return "active"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
 // A Server defines parameters for running servers that accept connections over
 // TCP or unix domains.
 type Server struct {
-	Addr     string      // address to listen on
-	Handler  Handler     // handler to invoke on new connections
-	ErrorLog *log.Logger // the logger used to output internal errors
+	Addr      string      // address to listen on
+	Handler   Handler     // handler to invoke on new connections
+	ErrorLog  *log.Logger // the logger used to output internal errors
+	TLSConfig *tls.Config // used to listen when Addr needs encryption
+
+	MaxConns      int                       // maximum number of simultaneous connections, zero means no limit
+	MaxConnsPerIP int                       // maximum number of simultaneous connections from a single IP, zero means no limit
+	IdleTimeout   time.Duration             // max time between reads/writes on a conn before it's closed; refreshed on activity, ignored if ReadTimeout or WriteTimeout is set
+	ReadTimeout   time.Duration             // deadline set on a conn's reads before dispatching to the Handler
+	WriteTimeout  time.Duration             // deadline set on a conn's writes before dispatching to the Handler
+	ConnState     func(net.Conn, ConnState) // invoked on connection state transitions, if not nil
+	ProxyProtocol bool                      // wrap accepted listeners with ProxyProtocolListener
+
+	mu            sync.Mutex
+	listeners     map[net.Listener]struct{}
+	listenerOrder []net.Listener // tracked listeners in the order Serve was called for them, for Restart
+	conns         map[net.Conn]struct{}
+	connsPerIP  map[string]int
+	join        *sync.WaitGroup
+	cancel      context.CancelFunc
+	inShutdown  int32 // accessed atomically
+	activeConns int32 // accessed atomically
 }
 
 // ListenAndServe listens on the server address and then call Serve to handle
-// the incoming connections.
+// the incoming connections. If Addr uses the tls://, https://, quic://, or
+// udp+quic:// scheme, the listener is established through ListenTLS using
+// s.TLSConfig, so callers don't need to build the TLS plumbing themselves.
 func (s *Server) ListenAndServe() (err error) {
 	var lstn net.Listener
 
-	if lstn, err = Listen(s.Addr); err == nil {
+	if needsTLS(s.Addr) {
+		lstn, err = ListenTLS(s.Addr, s.TLSConfig)
+	} else {
+		lstn, err = Listen(s.Addr)
+	}
+
+	if err == nil {
 		err = s.Serve(lstn)
 	}
 
@@ -70,14 +137,26 @@ func (s *Server) ListenAndServe() (err error) {
 
 // Serve accepts incoming connections on the Listener lstn, creating a new
 // service goroutine for each. The service goroutines simply invoke the
-// handler's ServeConn method.
+// handler's ServeConn method. If s.ProxyProtocol is set, lstn is wrapped with
+// a ProxyProtocolListener so Handlers see the client address reported by the
+// upstream load balancer rather than the load balancer's own address.
 func (s *Server) Serve(lstn net.Listener) (err error) {
+	s.trackListener(lstn, true)
+	defer s.trackListener(lstn, false)
 	defer lstn.Close()
 
-	join := &sync.WaitGroup{}
+	acceptor := lstn
+	if s.ProxyProtocol {
+		acceptor = NewProxyProtocolListener(lstn)
+	}
+
+	join := s.joinGroup()
 	defer join.Wait()
 
 	context, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
 	defer cancel()
 
 	errf := func(err error, backoff time.Duration) {
@@ -87,26 +166,436 @@ func (s *Server) Serve(lstn net.Listener) (err error) {
 	for {
 		var conn net.Conn
 
-		if conn, err = Accept(lstn, errf); err != nil {
+		s.waitForConnSlot(errf)
+
+		if conn, err = Accept(acceptor, errf); err != nil {
+			if s.shuttingDown() {
+				err = nil
+			}
 			return
 		}
 
+		conn = s.wrapIdleTimeout(conn)
+
+		s.trackConn(conn, true)
+		s.setConnState(conn, StateNew)
+		s.setDeadlines(conn)
+
 		join.Add(1)
 		go s.serve(conn, context, join)
 	}
 }
 
+// serve runs on its own goroutine per accepted connection, so that resolving
+// conn's remote IP (needed for MaxConnsPerIP, and which can block for a
+// while, e.g. on a ProxyProtocolListener conn whose header hasn't arrived
+// yet) never holds up Serve's shared accept loop.
 func (s *Server) serve(conn net.Conn, context context.Context, join *sync.WaitGroup) {
+	defer join.Done()
+	defer s.trackConn(conn, false)
+
+	ip := connIP(conn)
+
+	// Deadlines are applied again here, after connIP has had a
+	// ProxyProtocolListener conn parse its header, since that parse clears
+	// the read deadline Serve set.
+	s.setDeadlines(conn)
+
+	if s.MaxConnsPerIP > 0 && s.ipConnCount(ip) >= s.MaxConnsPerIP {
+		s.logf("netx: too many connections (%d) from %s, closing", s.MaxConnsPerIP, ip)
+		s.setConnState(conn, StateClosed)
+		conn.Close()
+		return
+	}
+
 	defer func(addr string) {
 		if err := recover(); err != nil {
 			s.recover(err, addr)
 		}
 	}(conn.RemoteAddr().String())
-	defer join.Done()
+	defer s.setConnState(conn, StateClosed)
+	defer s.addIPConn(ip, -1)
 	defer conn.Close()
+
+	s.addIPConn(ip, 1)
+	s.setConnState(conn, StateActive)
 	s.Handler.ServeConn(conn, context)
 }
 
+// waitForConnSlot blocks the accept loop, reporting a temporary error to errf
+// with an increasing backoff, for as long as MaxConns active connections are
+// already being served.
+func (s *Server) waitForConnSlot(errf func(error, time.Duration)) {
+	if s.MaxConns <= 0 {
+		return
+	}
+
+	backoff := 5 * time.Millisecond
+	for atomic.LoadInt32(&s.activeConns) >= int32(s.MaxConns) {
+		if s.shuttingDown() {
+			return
+		}
+
+		errf(errMaxConns, backoff)
+		time.Sleep(backoff)
+
+		if backoff *= 2; backoff > time.Second {
+			backoff = time.Second
+		}
+	}
+}
+
+// errMaxConns is reported to the accept loop's errf while it is waiting for
+// a connection slot to free up because MaxConns has been reached.
+var errMaxConns = tempError("netx: max connections reached")
+
+// tempError is a minimal error that satisfies the Temporary() bool interface
+// the existing Accept backoff logic expects.
+type tempError string
+
+func (e tempError) Error() string   { return string(e) }
+func (e tempError) Temporary() bool { return true }
+func (e tempError) Timeout() bool   { return false }
+
+// connIP extracts the IP portion of conn's remote address, used to key
+// MaxConnsPerIP tracking.
+func connIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// setDeadlines applies ReadTimeout and WriteTimeout to conn before it's
+// handed to the Handler. IdleTimeout, when neither of those is set, is
+// enforced instead by wrapIdleTimeout wrapping conn before it ever reaches
+// here, so it isn't dealt with in this function.
+func (s *Server) setDeadlines(conn net.Conn) {
+	now := time.Now()
+
+	if s.ReadTimeout > 0 {
+		conn.SetReadDeadline(now.Add(s.ReadTimeout))
+	}
+	if s.WriteTimeout > 0 {
+		conn.SetWriteDeadline(now.Add(s.WriteTimeout))
+	}
+}
+
+// wrapIdleTimeout wraps conn so that, so long as ReadTimeout and WriteTimeout
+// are both unset, its deadline is refreshed on every Read and Write to
+// s.IdleTimeout in the future. This makes IdleTimeout bound the time between
+// activity on the conn, rather than the conn's overall lifetime.
+func (s *Server) wrapIdleTimeout(conn net.Conn) net.Conn {
+	if s.IdleTimeout <= 0 || s.ReadTimeout > 0 || s.WriteTimeout > 0 {
+		return conn
+	}
+	return &idleTimeoutConn{Conn: conn, timeout: s.IdleTimeout}
+}
+
+// idleTimeoutConn wraps a net.Conn, refreshing its deadline on every Read and
+// Write so it's closed after timeout elapses with no activity, rather than
+// after timeout elapses from when it was dispatched to the Handler.
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleTimeoutConn) Read(b []byte) (int, error) {
+	c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(b)
+}
+
+func (c *idleTimeoutConn) Write(b []byte) (int, error) {
+	c.Conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(b)
+}
+
+func (s *Server) setConnState(conn net.Conn, state ConnState) {
+	if state == StateNew {
+		atomic.AddInt32(&s.activeConns, 1)
+	} else if state == StateClosed {
+		atomic.AddInt32(&s.activeConns, -1)
+	}
+	if s.ConnState != nil {
+		s.ConnState(conn, state)
+	}
+}
+
+func (s *Server) addIPConn(ip string, delta int) {
+	if len(ip) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.connsPerIP == nil {
+		s.connsPerIP = make(map[string]int)
+	}
+
+	s.connsPerIP[ip] += delta
+	if s.connsPerIP[ip] <= 0 {
+		delete(s.connsPerIP, ip)
+	}
+}
+
+func (s *Server) ipConnCount(ip string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connsPerIP[ip]
+}
+
+// Shutdown gracefully shuts the server down: it stops accepting new
+// connections, cancels the context passed to Handler.ServeConn so handlers
+// that watch it can wind down, and then blocks until either every connection's
+// ServeConn call has returned or ctx expires, whichever comes first. If ctx expires first,
+// Shutdown forces the remaining connections closed before returning ctx.Err().
+func (s *Server) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&s.inShutdown, 1)
+
+	s.mu.Lock()
+	for lstn := range s.listeners {
+		lstn.Close()
+	}
+	if s.cancel != nil {
+		s.cancel()
+	}
+	join := s.join
+	s.mu.Unlock()
+
+	if join == nil {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		join.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.closeConns()
+		return ctx.Err()
+	}
+}
+
+// restartReadyTimeout bounds how long Restart waits for the child process to
+// call SignalReady before giving up on it and leaving this server running,
+// so a child that fails to start up can't turn a restart into an outage.
+const restartReadyTimeout = 30 * time.Second
+
+// Restart performs a zero-downtime reload of the server: it forks and execs
+// the current binary, handing the listening sockets tracked by the server to
+// the child as inherited file descriptors, waits for the child to signal
+// that it's ready by calling SignalReady, and only then gracefully shuts this
+// server down. The child is expected to pick the sockets back up by listening
+// on the corresponding fd:// address (see Listen), typically fd://0,
+// fd://1, and so on, in the order the listeners were added to the server.
+//
+// If the child doesn't call SignalReady within restartReadyTimeout, Restart
+// returns an error without shutting this server down, so a child that fails
+// to bind or panics on boot doesn't cause a gap in service.
+//
+// Restart requires every tracked listener to expose a File method (as
+// *net.TCPListener and *net.UnixListener do); it returns an error otherwise.
+func (s *Server) Restart() (err error) {
+	s.mu.Lock()
+	lstns := append([]net.Listener{}, s.listenerOrder...)
+	s.mu.Unlock()
+
+	lstnFiles := make([]*os.File, 0, len(lstns))
+	defer func() {
+		for _, f := range lstnFiles {
+			f.Close()
+		}
+	}()
+
+	for _, lstn := range lstns {
+		fdr, ok := lstn.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("netx: listener %T does not support Restart (missing a File method)", lstn)
+		}
+
+		var f *os.File
+		if f, err = fdr.File(); err != nil {
+			return
+		}
+		lstnFiles = append(lstnFiles, f)
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	defer readyR.Close()
+	defer readyW.Close()
+
+	readyFd := listenFdStart + len(lstnFiles)
+
+	path, err := os.Executable()
+	if err != nil {
+		return
+	}
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(append([]*os.File{}, lstnFiles...), readyW)
+	cmd.Env = append(os.Environ(),
+		"LISTEN_PID=", // so resolveFD in the child uses SOCKETMASTER_FD, not this process's systemd fds
+		"LISTEN_FDS=",
+		fmt.Sprintf("SOCKETMASTER_FD=%d", listenFdStart),
+		fmt.Sprintf("NETX_READY_FD=%d", readyFd),
+	)
+
+	if err = cmd.Start(); err != nil {
+		return
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		var b [1]byte
+		_, rerr := readyR.Read(b[:])
+		ready <- rerr
+	}()
+
+	select {
+	case rerr := <-ready:
+		if rerr != nil {
+			return fmt.Errorf("netx: child did not signal readiness: %s", rerr)
+		}
+	case <-time.After(restartReadyTimeout):
+		return fmt.Errorf("netx: child did not signal readiness within %v", restartReadyTimeout)
+	}
+
+	return s.Shutdown(context.Background())
+}
+
+// SignalReady tells a parent netx.Server that performed Restart that this
+// process has finished starting up and is ready to take over, by writing a
+// byte to the pipe file descriptor named in the NETX_READY_FD environment
+// variable. It's a no-op if that variable isn't set, so it's safe to call
+// unconditionally during startup whether or not the process was launched by
+// Restart.
+func SignalReady() error {
+	s := os.Getenv("NETX_READY_FD")
+	if len(s) == 0 {
+		return nil
+	}
+
+	fd, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("netx: NETX_READY_FD: %s", err)
+	}
+
+	f := os.NewFile(uintptr(fd), "ready")
+	if f == nil {
+		return fmt.Errorf("netx: NETX_READY_FD %d: not a valid file descriptor", fd)
+	}
+	defer f.Close()
+
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+// HandleSignals installs signal handlers that call Shutdown on SIGINT and
+// SIGTERM, and Restart on SIGHUP and SIGUSR1, logging (rather than returning)
+// any error they produce since there's no caller left to hand it to. It
+// returns a function that stops listening for those signals; call it, likely
+// via defer, once the server no longer needs to respond to them.
+func (s *Server) HandleSignals() (stop func()) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1)
+
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case recv := <-sig:
+				switch recv {
+				case syscall.SIGHUP, syscall.SIGUSR1:
+					if err := s.Restart(); err != nil {
+						s.logf("netx: restart failed: %v", err)
+					}
+				default:
+					ctx, cancel := context.WithTimeout(context.Background(), restartReadyTimeout)
+					if err := s.Shutdown(ctx); err != nil {
+						s.logf("netx: shutdown failed: %v", err)
+					}
+					cancel()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sig)
+		close(done)
+	}
+}
+
+func (s *Server) trackListener(lstn net.Listener, add bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	if add {
+		s.listeners[lstn] = struct{}{}
+		s.listenerOrder = append(s.listenerOrder, lstn)
+	} else {
+		delete(s.listeners, lstn)
+		for i, l := range s.listenerOrder {
+			if l == lstn {
+				s.listenerOrder = append(s.listenerOrder[:i], s.listenerOrder[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (s *Server) trackConn(conn net.Conn, add bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]struct{})
+	}
+	if add {
+		s.conns[conn] = struct{}{}
+	} else {
+		delete(s.conns, conn)
+	}
+}
+
+func (s *Server) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *Server) joinGroup() *sync.WaitGroup {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.join == nil {
+		s.join = &sync.WaitGroup{}
+	}
+	return s.join
+}
+
+func (s *Server) shuttingDown() bool {
+	return atomic.LoadInt32(&s.inShutdown) != 0
+}
+
 func (s *Server) recover(err interface{}, addr string) {
 	// Copied from https://golang.org/src/net/http/server.go
 	const size = 64 << 10